@@ -0,0 +1,49 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PowerOffMode controls how a BareMetalHost is powered off when the
+// operator needs to turn it off, either to enter a power-off state
+// requested by the user or as part of deprovisioning.
+type PowerOffMode string
+
+const (
+	// PowerOffModeHard powers the host off immediately, without asking
+	// the operating system to shut down cleanly first. This matches the
+	// operator's historical behavior.
+	PowerOffModeHard PowerOffMode = "hard"
+
+	// PowerOffModeSoft asks the BMC to request a graceful shutdown of
+	// the operating system before falling back to a hard power off if
+	// the host does not reach the off state within SoftPowerOffTimeout.
+	PowerOffModeSoft PowerOffMode = "soft"
+)
+
+// BareMetalHostSpec defines the desired state of a BareMetalHost.
+type BareMetalHostSpec struct {
+	// Should the server be online?
+	Online bool `json:"online"`
+
+	// PowerOffMode selects how the host is powered off: "hard" powers
+	// the host off immediately, "soft" requests a graceful shutdown of
+	// the operating system first. Defaults to "hard" when unset.
+	// +optional
+	// +kubebuilder:validation:Enum=hard;soft
+	PowerOffMode PowerOffMode `json:"powerOffMode,omitempty"`
+
+	// SoftPowerOffTimeout is how long to wait for a soft power off to
+	// complete before escalating to a hard power off. Ignored unless
+	// PowerOffMode is "soft". Defaults to 5 minutes when unset.
+	// +optional
+	SoftPowerOffTimeout *metav1.Duration `json:"softPowerOffTimeout,omitempty"`
+}
+
+// BareMetalHost is the Schema for the baremetalhosts API.
+type BareMetalHost struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec BareMetalHostSpec `json:"spec,omitempty"`
+}
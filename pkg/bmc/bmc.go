@@ -0,0 +1,11 @@
+// Package bmc contains the types used to talk to a host's baseboard
+// management controller, independent of the provisioner backend that
+// implements the conversation.
+package bmc
+
+// Credentials holds the username and password used to authenticate
+// with a host's BMC.
+type Credentials struct {
+	Username string
+	Password string
+}
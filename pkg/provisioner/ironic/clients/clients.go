@@ -0,0 +1,68 @@
+// Package clients builds gophercloud service clients for the Ironic and
+// Ironic Inspector APIs, handling the authentication schemes the
+// operator supports.
+package clients
+
+import (
+	"fmt"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/httpbasic"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/noauth"
+	baremetalintrospection "github.com/gophercloud/gophercloud/openstack/baremetalintrospection/noauth"
+)
+
+// AuthType identifies how the operator should authenticate with Ironic.
+type AuthType string
+
+const (
+	// NoAuth talks to Ironic directly, with no authentication.
+	NoAuth AuthType = "noauth"
+	// HTTPBasicAuth authenticates using an HTTP basic auth username and
+	// password.
+	HTTPBasicAuth AuthType = "http_basic"
+)
+
+// AuthConfig holds the configuration needed to authenticate with an
+// Ironic or Inspector endpoint.
+type AuthConfig struct {
+	Type     AuthType
+	Username string
+	Password string
+}
+
+// IronicClient returns a client configured to talk to the Ironic API at
+// the given endpoint.
+func IronicClient(endpoint string, auth AuthConfig) (client *gophercloud.ServiceClient, err error) {
+	switch auth.Type {
+	case NoAuth:
+		client, err = noauth.NewBareMetalNoAuth(noauth.EndpointOpts{
+			IronicEndpoint: endpoint,
+		})
+	case HTTPBasicAuth:
+		client, err = httpbasic.NewBareMetalHTTPBasic(httpbasic.EndpointOpts{
+			IronicEndpoint:     endpoint,
+			IronicUser:         auth.Username,
+			IronicUserPassword: auth.Password,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported auth type %q", auth.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// InspectorClient returns a client configured to talk to the Ironic
+// Inspector API at the given endpoint.
+func InspectorClient(endpoint string, auth AuthConfig) (client *gophercloud.ServiceClient, err error) {
+	client, err = baremetalintrospection.NewBareMetalIntrospectionNoAuth(
+		baremetalintrospection.EndpointOpts{
+			IronicInspectorEndpoint: endpoint,
+		})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
@@ -0,0 +1,155 @@
+// Package events lets the ironic provisioner learn about power and
+// provisioning state transitions as Ironic observes them, instead of
+// waiting for the next polling interval. It is optional: when no event
+// endpoint is configured, or the connection cannot be kept up, callers
+// simply fall back to polling Ironic directly.
+package events
+
+import (
+	"context"
+	"time"
+)
+
+// NodeStateChanged describes a state transition Ironic has observed
+// for one of its nodes.
+type NodeStateChanged struct {
+	UUID           string
+	PowerState     string
+	ProvisionState string
+}
+
+// Dialer opens a Stream of node state transitions. Implementations
+// wrap whatever transport backs the event endpoint: oslo.messaging
+// notifications proxied through a sidecar, or a websocket bridge
+// exposed alongside the Ironic API.
+type Dialer interface {
+	Dial(ctx context.Context) (Stream, error)
+}
+
+// Stream is a single connection to an event source.
+type Stream interface {
+	// Next blocks until the next event is available, or returns an
+	// error (including on a clean shutdown from the far end) so the
+	// caller can reconnect.
+	Next() (NodeStateChanged, error)
+	Close() error
+}
+
+// Source streams NodeStateChanged events for as long as Connect's
+// caller keeps it open, reconnecting with backoff if the underlying
+// Stream fails.
+type Source struct {
+	events chan NodeStateChanged
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Connect starts streaming events from dialer in the background,
+// returning a Source whose Events channel is fed as they arrive. The
+// caller must call Close when finished. Reconnects use an exponential
+// backoff capped at reconnectMaxBackoff.
+func Connect(dialer Dialer) *Source {
+	return connect(dialer, reconnectBaseBackoff, reconnectMaxBackoff)
+}
+
+// connect is Connect with the backoff bounds broken out so tests can
+// drive many reconnect cycles without waiting out real delays.
+func connect(dialer Dialer, baseBackoff, maxBackoff time.Duration) *Source {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Source{
+		events: make(chan NodeStateChanged),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go s.run(ctx, dialer, baseBackoff, maxBackoff)
+	return s
+}
+
+// Events returns the channel new state transitions are delivered on.
+// It is closed once the Source is closed.
+func (s *Source) Events() <-chan NodeStateChanged {
+	return s.events
+}
+
+// Close disconnects from the event source and stops reconnecting.
+func (s *Source) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+const (
+	reconnectBaseBackoff = time.Second
+	reconnectMaxBackoff  = 30 * time.Second
+)
+
+func (s *Source) run(ctx context.Context, dialer Dialer, baseBackoff, maxBackoff time.Duration) {
+	defer close(s.done)
+	defer close(s.events)
+
+	backoff := baseBackoff
+	for {
+		stream, err := dialer.Dial(ctx)
+		if err != nil {
+			if !sleepOrDone(ctx, backoff) {
+				return
+			}
+			backoff = nextBackoff(backoff, maxBackoff)
+			continue
+		}
+
+		delivered := s.forward(ctx, stream)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Only a stream that actually delivered something earns back
+		// the base backoff: one that dials fine but drops immediately
+		// keeps climbing, so a flapping endpoint doesn't turn into a
+		// tight reconnect loop.
+		if delivered {
+			backoff = baseBackoff
+		} else {
+			backoff = nextBackoff(backoff, maxBackoff)
+		}
+		if !sleepOrDone(ctx, backoff) {
+			return
+		}
+	}
+}
+
+// forward relays events from stream onto s.events until it errors or
+// ctx is cancelled, reporting whether at least one event made it
+// through before the stream ended.
+func (s *Source) forward(ctx context.Context, stream Stream) (delivered bool) {
+	defer stream.Close() //nolint:errcheck
+	for {
+		evt, err := stream.Next()
+		if err != nil {
+			return delivered
+		}
+		select {
+		case s.events <- evt:
+			delivered = true
+		case <-ctx.Done():
+			return delivered
+		}
+	}
+}
+
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		next = max
+	}
+	return next
+}
+
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// errStreamDone is returned by scriptedStream once its events are
+// exhausted, standing in for a dropped connection.
+var errStreamDone = errors.New("stream done")
+
+// scriptedStream hands back a fixed list of events, then errors.
+type scriptedStream struct {
+	events []NodeStateChanged
+	i      int
+	closed int32
+}
+
+func (s *scriptedStream) Next() (NodeStateChanged, error) {
+	if s.i >= len(s.events) {
+		return NodeStateChanged{}, errStreamDone
+	}
+	e := s.events[s.i]
+	s.i++
+	return e, nil
+}
+
+func (s *scriptedStream) Close() error {
+	atomic.AddInt32(&s.closed, 1)
+	return nil
+}
+
+// scriptedDialer hands out the next scriptedStream in streams on each
+// Dial call, counting how many times it was asked to connect.
+type scriptedDialer struct {
+	streams []*scriptedStream
+	dials   int32
+}
+
+func (d *scriptedDialer) Dial(ctx context.Context) (Stream, error) {
+	n := int(atomic.AddInt32(&d.dials, 1)) - 1
+	if n >= len(d.streams) {
+		n = len(d.streams) - 1
+	}
+	return d.streams[n], nil
+}
+
+// TestReconnectDeliversEventsAcrossDrops drives a real Dialer through
+// a connection drop and reconnect, checking that events from both
+// streams make it out the Source in order.
+func TestReconnectDeliversEventsAcrossDrops(t *testing.T) {
+	first := &scriptedStream{events: []NodeStateChanged{{UUID: "a"}}}
+	second := &scriptedStream{events: []NodeStateChanged{{UUID: "b"}, {UUID: "c"}}}
+	dialer := &scriptedDialer{streams: []*scriptedStream{first, second}}
+
+	s := connect(dialer, time.Millisecond, 4*time.Millisecond)
+	defer s.Close()
+
+	var got []string
+	for len(got) < 3 {
+		select {
+		case evt := <-s.Events():
+			got = append(got, evt.UUID)
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for events, got %v so far", got)
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&first.closed))
+}
+
+// countingDialer always hands out a stream that errors immediately
+// without delivering anything, simulating an endpoint that accepts the
+// connection but drops the stream right away.
+type countingDialer struct {
+	dials int32
+}
+
+func (d *countingDialer) Dial(ctx context.Context) (Stream, error) {
+	atomic.AddInt32(&d.dials, 1)
+	return &scriptedStream{}, nil
+}
+
+// TestReconnectBacksOffOnImmediateStreamDrop locks down that a stream
+// dropping right after it connects still gets the same backoff as a
+// failed Dial, instead of hammering the endpoint in a tight loop.
+func TestReconnectBacksOffOnImmediateStreamDrop(t *testing.T) {
+	dialer := &countingDialer{}
+	s := connect(dialer, time.Millisecond, 4*time.Millisecond)
+	defer s.Close()
+
+	go func() {
+		for range s.Events() { //nolint:revive
+		}
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	dials := atomic.LoadInt32(&dialer.dials)
+	// With no backoff this would rack up thousands of dials in
+	// 100ms; backing off bounds it to a small, predictable number.
+	assert.Less(t, int(dials), 50)
+}
+
+// TestClosePropagatesShutdown checks that Close stops the reconnect
+// loop and closes the events channel rather than leaking the
+// goroutine.
+func TestClosePropagatesShutdown(t *testing.T) {
+	dialer := &countingDialer{}
+	s := connect(dialer, time.Millisecond, 4*time.Millisecond)
+
+	go func() {
+		for range s.Events() { //nolint:revive
+		}
+	}()
+
+	assert.NoError(t, s.Close())
+
+	_, ok := <-s.Events()
+	assert.False(t, ok)
+}
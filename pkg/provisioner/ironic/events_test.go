@@ -0,0 +1,104 @@
+package ironic
+
+import (
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/events"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
+)
+
+// TestPowerOnEventDriven checks that a node state transition pushed
+// through the event source lets PowerOn reconcile immediately, rather
+// than returning the usual 10-second polling RequeueAfter.
+func TestPowerOnEventDriven(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironicServer := testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+		PowerState:       powerOff,
+		TargetPowerState: powerOn,
+		UUID:             nodeUUID,
+	})
+	ironicServer.Start()
+	defer ironicServer.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironicServer.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	// Without an event source, the operator is still waiting for
+	// Ironic to finish the transition it already started.
+	result, err := prov.PowerOn()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Equal(t, powerLockedRetry, result.RequeueAfter)
+
+	fakeSource := testserver.NewFakeEventSource()
+	prov.events = fakeSource
+	fakeSource.Emit(events.NodeStateChanged{UUID: nodeUUID, PowerState: powerOn})
+
+	result, err = prov.PowerOn()
+	assert.NoError(t, err)
+	assert.False(t, result.Dirty)
+	assert.Zero(t, result.RequeueAfter)
+}
+
+// TestEventSourceDegradesToPolling checks that a closed event source
+// is dropped cleanly, leaving the provisioner to fall back to polling
+// rather than panicking on a closed channel.
+func TestEventSourceDegradesToPolling(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironicServer := testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+		PowerState: powerOn,
+		UUID:       nodeUUID,
+	})
+	ironicServer.Start()
+	defer ironicServer.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironicServer.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+
+	fakeSource := testserver.NewFakeEventSource()
+	prov.events = fakeSource
+	fakeSource.Close()
+
+	result, err := prov.PowerOn()
+	assert.NoError(t, err)
+	assert.False(t, result.Dirty)
+	assert.Nil(t, prov.events)
+}
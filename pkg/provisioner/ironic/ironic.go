@@ -0,0 +1,425 @@
+// Package ironic implements the provisioner.Provisioner interface by
+// talking to an Ironic API server (and its companion Inspector).
+package ironic
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	"github.com/metal3-io/baremetal-operator/pkg/bmc"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/events"
+	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/powerfsm"
+)
+
+// eventSource is the subset of events.Source the provisioner relies
+// on, defined locally so tests can supply a fake without standing up a
+// real events.Dialer.
+type eventSource interface {
+	Events() <-chan events.NodeStateChanged
+}
+
+// ErrBMCBusy is returned when a power operation is abandoned after
+// Ironic kept reporting the node as locked by another caller (HTTP
+// 409) for longer than lockedHostRetryPolicy allows.
+var ErrBMCBusy = errors.New("bmc busy: exceeded retry budget waiting for locked host")
+
+// reasonRegistrationError is the event reason published when the
+// provisioner gives up on a host rather than keep retrying.
+const reasonRegistrationError = "RegistrationError"
+
+const (
+	powerOn          = string(nodes.PowerOn)
+	powerOff         = string(nodes.PowerOff)
+	softPowerOff     = "soft power off"
+	powerLockedRetry = 10 * time.Second
+
+	// defaultSoftPowerOffTimeout is how long the provisioner waits for
+	// a soft power off to complete before escalating to a hard power
+	// off, when the host does not specify its own timeout.
+	defaultSoftPowerOffTimeout = 5 * time.Minute
+)
+
+// provisioningStatus is the subset of state the provisioner needs to
+// track across reconciles of a single node: the soft-off grace clock,
+// the hard-off escalation flag, and the locked-host backoff counter.
+// It is shaped to be persisted on BareMetalHost.Status and rebuilt from
+// it on each reconcile, but this tree has no controller wiring that
+// round-trip -- newProvisionerWithSettings always starts a fresh,
+// zero-valued provisioningStatus, so none of these fields survive
+// across provisioner instances today.
+type provisioningStatus struct {
+	// ID is the Ironic node UUID backing this host.
+	ID string
+
+	// SoftPowerOffStarted records when a soft power off was first
+	// requested, so later calls can tell whether the grace period has
+	// elapsed. The zero value means no soft power off is in progress.
+	SoftPowerOffStarted time.Time
+
+	// HardPowerOffRequested is set once a soft power off has escalated
+	// (or fallen back) to a hard power off, so a later call waits for
+	// that hard power off to land instead of re-issuing a soft power
+	// off on top of it.
+	HardPowerOffRequested bool
+
+	// PowerLockAttempts counts consecutive HTTP 409 (locked host)
+	// responses seen for the power operation in progress on this node.
+	// It resets to zero as soon as Ironic accepts a request. There is
+	// one provisioningStatus per BareMetalHost, so this single counter
+	// is implicitly keyed by the node UUID in ID -- it does not need its
+	// own map.
+	PowerLockAttempts int
+}
+
+// ironicProvisioner implements provisioner.Provisioner by driving an
+// Ironic node through its client and inspector API clients.
+type ironicProvisioner struct {
+	host      *metal3v1alpha1.BareMetalHost
+	bmcCreds  bmc.Credentials
+	publisher provisioner.EventPublisher
+	client    *gophercloud.ServiceClient
+	inspector *gophercloud.ServiceClient
+	status    provisioningStatus
+	retry     retryPolicy
+
+	// events, when set, delivers node state transitions pushed by
+	// Ironic instead of requiring the controller to poll for them. It
+	// is nil when no event endpoint is configured.
+	events        eventSource
+	lastNodeEvent *events.NodeStateChanged
+}
+
+// newProvisionerWithSettings builds an ironicProvisioner talking to the
+// given Ironic and Inspector endpoints. It exists separately from the
+// production constructor so tests can point it at a testserver mock
+// instead of the environment-configured endpoints. eventsDialer is
+// optional: when non-nil, the provisioner connects it immediately and
+// reconciles off pushed node state transitions instead of only
+// polling; pass nil to keep today's polling-only behavior.
+func newProvisionerWithSettings(host *metal3v1alpha1.BareMetalHost, bmcCreds bmc.Credentials,
+	publisher provisioner.EventPublisher,
+	ironicEndpoint string, ironicAuth clients.AuthConfig,
+	inspectorEndpoint string, inspectorAuth clients.AuthConfig,
+	eventsDialer events.Dialer) (*ironicProvisioner, error) {
+
+	client, err := clients.IronicClient(ironicEndpoint, ironicAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ironic client: %w", err)
+	}
+
+	inspector, err := clients.InspectorClient(inspectorEndpoint, inspectorAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Inspector client: %w", err)
+	}
+
+	p := &ironicProvisioner{
+		host:      host,
+		bmcCreds:  bmcCreds,
+		publisher: publisher,
+		client:    client,
+		inspector: inspector,
+		retry:     lockedHostRetryPolicy,
+	}
+	if eventsDialer != nil {
+		p.events = events.Connect(eventsDialer)
+	}
+	return p, nil
+}
+
+// getNode fetches the current state of the Ironic node backing this
+// host.
+func (p *ironicProvisioner) getNode() (*nodes.Node, error) {
+	return nodes.Get(p.client, p.status.ID).Extract()
+}
+
+// setPowerState asks Ironic to move the node to the given target power
+// state.
+func (p *ironicProvisioner) setPowerState(target nodes.TargetPowerState) error {
+	return nodes.ChangePowerState(p.client, p.status.ID, nodes.PowerStateOpts{
+		Target: target,
+	}).ExtractErr()
+}
+
+// softPowerOffTimeout returns the configured grace period, falling
+// back to defaultSoftPowerOffTimeout when the host does not specify
+// one.
+func (p *ironicProvisioner) softPowerOffTimeout() time.Duration {
+	if p.host.Spec.SoftPowerOffTimeout != nil {
+		return p.host.Spec.SoftPowerOffTimeout.Duration
+	}
+	return defaultSoftPowerOffTimeout
+}
+
+// PowerOn ensures the host is powered on.
+func (p *ironicProvisioner) PowerOn() (result provisioner.Result, err error) {
+	// A pending hard power off (escalated or fallen back from a soft
+	// one) belongs to the power-off cycle that is being abandoned in
+	// favour of powering back on: clear it so a later PowerOff() in
+	// Soft mode starts a fresh soft power off negotiation instead of
+	// jumping straight to hard.
+	p.status.HardPowerOffRequested = false
+	return p.changePower(powerOn)
+}
+
+// PowerOff ensures the host is powered off, asking Ironic for a soft
+// power off first when the host requests it, and escalating to a hard
+// power off once the grace period elapses (or immediately if Ironic's
+// driver does not support a soft power off).
+func (p *ironicProvisioner) PowerOff() (result provisioner.Result, err error) {
+	if p.host.Spec.PowerOffMode != metal3v1alpha1.PowerOffModeSoft {
+		return p.changePower(powerOff)
+	}
+	return p.softPowerOff()
+}
+
+// ChangePower moves the host towards the given target power state. It
+// is the entry point used for reboots, which ask for powerOff followed
+// by powerOn. The power-off leg goes through the same soft power off
+// path as PowerOff when the host asks for it, so a soft reboot does
+// not yank power out from under the OS.
+func (p *ironicProvisioner) ChangePower(target string) (result provisioner.Result, err error) {
+	if target == powerOff && p.host.Spec.PowerOffMode == metal3v1alpha1.PowerOffModeSoft {
+		return p.softPowerOff()
+	}
+	return p.changePower(target)
+}
+
+func (p *ironicProvisioner) softPowerOff() (result provisioner.Result, err error) {
+	if p.status.HardPowerOffRequested {
+		// A hard power off is already in flight, either because the
+		// soft power off timed out or because the driver does not
+		// support one: wait for it rather than re-issuing a soft
+		// power off on top of it.
+		return p.awaitHardPowerOff()
+	}
+
+	node, err := p.getNode()
+	if err != nil {
+		return result, fmt.Errorf("could not determine current node state: %w", err)
+	}
+
+	if node.PowerState == powerOff && node.TargetPowerState == "" {
+		p.status.SoftPowerOffStarted = time.Time{}
+		return result, nil
+	}
+
+	if !p.status.SoftPowerOffStarted.IsZero() {
+		if time.Since(p.status.SoftPowerOffStarted) < p.softPowerOffTimeout() {
+			result.Dirty = true
+			result.RequeueAfter = powerLockedRetry
+			return result, nil
+		}
+
+		// The grace period elapsed without Ironic reporting the node
+		// off: escalate to a hard power off.
+		p.publisher("SoftPowerOffTimedOut", "soft power off did not complete in time, forcing power off")
+		p.status.SoftPowerOffStarted = time.Time{}
+		p.status.HardPowerOffRequested = true
+		return p.awaitHardPowerOff()
+	}
+
+	err = p.setPowerState(nodes.TargetPowerState(softPowerOff))
+	switch {
+	case err == nil:
+		p.status.PowerLockAttempts = 0
+		p.status.SoftPowerOffStarted = time.Now()
+		result.Dirty = true
+		result.RequeueAfter = powerLockedRetry
+		return result, nil
+
+	case isNotSupported(err):
+		// This driver does not implement a soft power off: fall back
+		// to a hard power off immediately.
+		p.publisher("SoftPowerOffUnsupported", "driver does not support soft power off, forcing power off")
+		p.status.HardPowerOffRequested = true
+		return p.awaitHardPowerOff()
+
+	case isConflict(err):
+		return p.handleLockedHost()
+
+	default:
+		return result, fmt.Errorf("failed to request soft power off: %w", err)
+	}
+}
+
+// awaitHardPowerOff drives the hard power off requested once a soft
+// power off escalated or fell back, clearing HardPowerOffRequested
+// once changePower reports the node has actually settled on off.
+func (p *ironicProvisioner) awaitHardPowerOff() (result provisioner.Result, err error) {
+	result, err = p.changePower(powerOff)
+	if err == nil && !result.Dirty {
+		p.status.HardPowerOffRequested = false
+	}
+	return result, err
+}
+
+// handleLockedHost backs off and retries a power operation that Ironic
+// rejected because the node is locked by another request, giving up
+// once the node's retry budget is exhausted.
+func (p *ironicProvisioner) handleLockedHost() (result provisioner.Result, err error) {
+	attempt := p.status.PowerLockAttempts
+	if p.retry.exhausted(attempt) {
+		p.status.PowerLockAttempts = 0
+		p.publisher(reasonRegistrationError, "BMC busy: giving up on node after repeated locked-host responses")
+		result.ErrorMessage = "BMC busy"
+		return result, ErrBMCBusy
+	}
+
+	p.status.PowerLockAttempts = attempt + 1
+	result.Dirty = true
+	result.RequeueAfter = p.retry.requeueAfter(attempt)
+	return result, nil
+}
+
+// drainEvents consumes any state transitions Ironic has pushed for
+// this node since the last call, without blocking when none are
+// pending, and remembers the most recent one.
+func (p *ironicProvisioner) drainEvents() {
+	if p.events == nil {
+		return
+	}
+	for {
+		select {
+		case evt, ok := <-p.events.Events():
+			if !ok {
+				// The event source gave up reconnecting: fall back to
+				// polling from here on.
+				p.events = nil
+				return
+			}
+			if evt.UUID == p.status.ID {
+				e := evt
+				p.lastNodeEvent = &e
+			}
+		default:
+			return
+		}
+	}
+}
+
+// changePower drives the node towards target through powerfsm: the
+// node's observed fields (relative to target, since Ironic does not
+// tell us which direction an in-progress TargetPowerState is chasing)
+// are translated into the state a freshly built Machine would be in,
+// and firing the matching request event tells us whether the node is
+// already settled, already in flight, queued behind a provisioning
+// action, or needs a new request sent to Ironic. The Machine itself is
+// not persisted across reconciles -- provisioningStatus has nowhere to
+// park it -- so it is rebuilt from the node on every call; only the
+// locked-host retry budget survives between calls, in p.status.
+func (p *ironicProvisioner) changePower(target string) (result provisioner.Result, err error) {
+	p.drainEvents()
+	if p.lastNodeEvent != nil && p.lastNodeEvent.PowerState == target {
+		// Ironic already told us the node reached the target power
+		// state: reconcile immediately instead of fetching the node
+		// just to feed powerfsm.IronicAck the same answer we already
+		// have.
+		p.lastNodeEvent = nil
+		p.status.PowerLockAttempts = 0
+		return result, nil
+	}
+
+	node, err := p.getNode()
+	if err != nil {
+		return result, fmt.Errorf("could not determine current node state: %w", err)
+	}
+
+	initial := deriveState(node, target)
+	alreadyInFlight := initial == powerfsm.TurningOn || initial == powerfsm.TurningOff
+
+	m := powerfsm.New(initial)
+	res, err := m.Fire(requestEvent(target), node.TargetProvisionState != "")
+	if err != nil {
+		return result, err
+	}
+
+	if res.State == powerfsm.On || res.State == powerfsm.Off {
+		return result, nil
+	}
+
+	if alreadyInFlight || res.State == powerfsm.WaitingForProvisioning {
+		result.Dirty = true
+		result.RequeueAfter = res.RequeueAfter
+		return result, nil
+	}
+
+	// A fresh TurningOn/TurningOff transition: ask Ironic to make it so.
+	err = p.setPowerState(nodes.TargetPowerState(target))
+	switch {
+	case err == nil:
+		p.status.PowerLockAttempts = 0
+		result.Dirty = true
+		return result, nil
+	case isConflict(err):
+		// m is only live for this call (see the Machine doc comment),
+		// but firing IronicConflict on it still drives the event rather
+		// than leaving it unused: m.state is always TurningOn or
+		// TurningOff here, so this always succeeds. The actual requeue
+		// timing still comes from the retry policy, not res.
+		_, _ = m.Fire(powerfsm.IronicConflict, node.TargetProvisionState != "")
+		return p.handleLockedHost()
+	default:
+		return result, fmt.Errorf("failed to request power %s: %w", target, err)
+	}
+}
+
+// deriveState reports the powerfsm.State a node is in relative to
+// target: already settled on it, mid-transition towards it, or settled
+// on (or moving towards) the opposite state. Ironic only tells us a
+// single TargetPowerState, not which of our possibly-competing
+// requests it belongs to, so "mid-transition" is judged by comparing
+// TargetPowerState against target rather than treating any non-empty
+// value as in flight.
+func deriveState(node *nodes.Node, target string) powerfsm.State {
+	if node.TargetPowerState == target {
+		if target == powerOn {
+			return powerfsm.TurningOn
+		}
+		return powerfsm.TurningOff
+	}
+
+	if node.PowerState == target && node.TargetPowerState == "" {
+		if target == powerOn {
+			return powerfsm.On
+		}
+		return powerfsm.Off
+	}
+
+	if target == powerOn {
+		return powerfsm.Off
+	}
+	return powerfsm.On
+}
+
+// requestEvent returns the powerfsm.Event requesting target.
+func requestEvent(target string) powerfsm.Event {
+	if target == powerOn {
+		return powerfsm.RequestOn
+	}
+	return powerfsm.RequestOff
+}
+
+func isConflict(err error) bool {
+	return statusCode(err) == http.StatusConflict
+}
+
+func isNotSupported(err error) bool {
+	return statusCode(err) == http.StatusNotImplemented
+}
+
+// statusCode extracts the HTTP status code from a gophercloud error,
+// returning 0 if err does not carry one.
+func statusCode(err error) int {
+	if scErr, ok := err.(gophercloud.StatusCodeError); ok {
+		return scErr.GetStatusCode()
+	}
+	return 0
+}
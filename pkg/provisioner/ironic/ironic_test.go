@@ -0,0 +1,21 @@
+package ironic
+
+import (
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// makeHost returns a minimal BareMetalHost suitable for handing to
+// newProvisionerWithSettings in tests. Individual tests mutate the
+// returned Spec when they need non-default behavior.
+func makeHost() *metal3v1alpha1.BareMetalHost {
+	return &metal3v1alpha1.BareMetalHost{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "host",
+			Namespace: "myns",
+		},
+		Spec: metal3v1alpha1.BareMetalHostSpec{
+			Online: true,
+		},
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
 	"github.com/stretchr/testify/assert"
 
+	metal3v1alpha1 "github.com/metal3-io/baremetal-operator/pkg/apis/metal3/v1alpha1"
 	"github.com/metal3-io/baremetal-operator/pkg/bmc"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/clients"
 	"github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/testserver"
@@ -71,9 +72,8 @@ func TestPowerOn(t *testing.T) {
 				TargetProvisionState: "",
 				UUID:                 nodeUUID,
 			}).WithNodeStatesPower(nodeUUID, http.StatusConflict),
-			expectedRequestAfter: 10,
+			expectedRequestAfter: 2,
 			expectedDirty:        true,
-			expectedError:        true,
 		},
 	}
 
@@ -95,12 +95,14 @@ func TestPowerOn(t *testing.T) {
 			auth := clients.AuthConfig{Type: clients.NoAuth}
 			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
 				tc.ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+				nil,
 			)
 			if err != nil {
 				t.Fatalf("could not create provisioner: %s", err)
 			}
 
 			prov.status.ID = nodeUUID
+			prov.retry.jitter = func() time.Duration { return 0 }
 			result, err := prov.PowerOn()
 
 			assert.Equal(t, tc.expectedDirty, result.Dirty)
@@ -114,6 +116,125 @@ func TestPowerOn(t *testing.T) {
 	}
 }
 
+// TestPowerOnLockedHostBackoff drives repeated 409 responses through a
+// single provisioner instance and checks that the requeue delay grows
+// on each attempt, resets once Ironic accepts a request, and that the
+// provisioner gives up with ErrBMCBusy once the retry budget is spent.
+func TestPowerOnLockedHostBackoff(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironicServer := testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+		PowerState:           powerOff,
+		TargetPowerState:     powerOff,
+		TargetProvisionState: "",
+		UUID:                 nodeUUID,
+	}).WithNodeStatesPower(nodeUUID, http.StatusConflict)
+	ironicServer.Start()
+	defer ironicServer.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironicServer.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+	prov.retry.jitter = func() time.Duration { return 0 }
+
+	var previous time.Duration
+	for attempt := 0; attempt < prov.retry.maxAttempts; attempt++ {
+		result, err := prov.PowerOn()
+		assert.NoError(t, err)
+		assert.True(t, result.Dirty)
+		assert.Greater(t, result.RequeueAfter, previous, "requeue delay should grow with each locked-host attempt")
+		previous = result.RequeueAfter
+	}
+
+	// The budget is now spent: the provisioner should give up instead
+	// of requeuing again.
+	result, err := prov.PowerOn()
+	assert.ErrorIs(t, err, ErrBMCBusy)
+	assert.Zero(t, result.RequeueAfter)
+	assert.Equal(t, 0, prov.status.PowerLockAttempts)
+
+	// A fresh attempt after giving up starts the backoff over again.
+	prov.status.PowerLockAttempts = 0
+	result, err = prov.PowerOn()
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Second, result.RequeueAfter)
+	assert.Equal(t, 1, prov.status.PowerLockAttempts)
+
+	// Once Ironic accepts the request, the attempt counter resets to
+	// zero rather than carrying the locked-host count forward.
+	ironicServer.WithNodeStatesPower(nodeUUID, http.StatusAccepted)
+	result, err = prov.PowerOn()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, prov.status.PowerLockAttempts)
+}
+
+// TestPowerOffQueuesBehindProvisioningThenClears checks that a power
+// off request arriving while the node has a provisioning action in
+// flight is queued rather than sent to Ironic, and that it proceeds on
+// its own once the provisioning action resolves -- without the caller
+// needing to ask again.
+func TestPowerOffQueuesBehindProvisioningThenClears(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	node := nodes.Node{
+		PowerState:           powerOn,
+		TargetPowerState:     powerOn,
+		TargetProvisionState: string(nodes.TargetDeleted),
+		UUID:                 nodeUUID,
+	}
+	ironicServer := testserver.NewIronic(t).Ready().WithNode(node).
+		WithNodeStatesPower(nodeUUID, http.StatusAccepted)
+	ironicServer.Start()
+	defer ironicServer.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironicServer.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+	prov.status.ID = nodeUUID
+	prov.retry.jitter = func() time.Duration { return 0 }
+
+	result, err := prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Equal(t, 10*time.Second, result.RequeueAfter)
+
+	// The provisioning action finishes: the queued power off should now
+	// go through without any further input from the caller.
+	ironicServer.SetNodeTargetProvisionState(nodeUUID, "")
+
+	result, err = prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Zero(t, result.RequeueAfter)
+}
+
 func TestPowerOff(t *testing.T) {
 
 	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
@@ -121,9 +242,12 @@ func TestPowerOff(t *testing.T) {
 		name   string
 		ironic *testserver.IronicMock
 
-		expectedDirty        bool
-		expectedError        bool
-		expectedRequestAfter int
+		softPowerOff              bool
+		softPowerOffStarted       time.Duration // how long ago, zero means not yet requested
+		expectedDirty             bool
+		expectedError             bool
+		expectedRequestAfter      int
+		expectSoftOffStartedReset bool
 	}{
 		{
 			name: "node-already-power-off",
@@ -171,8 +295,70 @@ func TestPowerOff(t *testing.T) {
 				TargetProvisionState: "",
 				UUID:                 nodeUUID,
 			}).WithNodeStatesPower(nodeUUID, http.StatusConflict),
+			expectedRequestAfter: 2,
+			expectedDirty:        true,
+		},
+		{
+			name:         "soft power off requested",
+			softPowerOff: true,
+			ironic: testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+				PowerState:           powerOn,
+				TargetPowerState:     powerOn,
+				TargetProvisionState: "",
+				UUID:                 nodeUUID,
+			}).WithNodeStatesPowerForTarget(nodeUUID, softPowerOff, http.StatusAccepted),
+			expectedDirty:        true,
 			expectedRequestAfter: 10,
+		},
+		{
+			name:                "soft power off still within grace period",
+			softPowerOff:        true,
+			softPowerOffStarted: time.Minute,
+			ironic: testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+				PowerState:           powerOn,
+				TargetPowerState:     powerOn,
+				TargetProvisionState: "",
+				UUID:                 nodeUUID,
+			}),
 			expectedDirty:        true,
+			expectedRequestAfter: 10,
+		},
+		{
+			name:                "soft power off times out and escalates to hard power off",
+			softPowerOff:        true,
+			softPowerOffStarted: defaultSoftPowerOffTimeout + time.Minute,
+			ironic: testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+				PowerState:           powerOn,
+				TargetPowerState:     powerOn,
+				TargetProvisionState: "",
+				UUID:                 nodeUUID,
+			}).WithNodeStatesPowerForTarget(nodeUUID, powerOff, http.StatusAccepted),
+			expectedDirty: true,
+		},
+		{
+			name:                "soft power off succeeds within grace period",
+			softPowerOff:        true,
+			softPowerOffStarted: time.Minute,
+			ironic: testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+				PowerState:           powerOff,
+				TargetPowerState:     "",
+				TargetProvisionState: "",
+				UUID:                 nodeUUID,
+			}),
+			expectedDirty:             false,
+			expectSoftOffStartedReset: true,
+		},
+		{
+			name:         "soft power off unsupported by driver falls back immediately",
+			softPowerOff: true,
+			ironic: testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+				PowerState:           powerOn,
+				TargetPowerState:     powerOn,
+				TargetProvisionState: "",
+				UUID:                 nodeUUID,
+			}).WithNodeStatesPowerForTarget(nodeUUID, softPowerOff, http.StatusNotImplemented).
+				WithNodeStatesPowerForTarget(nodeUUID, powerOff, http.StatusAccepted),
+			expectedDirty: true,
 		},
 	}
 
@@ -190,16 +376,24 @@ func TestPowerOff(t *testing.T) {
 			defer inspector.Stop()
 
 			host := makeHost()
+			if tc.softPowerOff {
+				host.Spec.PowerOffMode = metal3v1alpha1.PowerOffModeSoft
+			}
 			publisher := func(reason, message string) {}
 			auth := clients.AuthConfig{Type: clients.NoAuth}
 			prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
 				tc.ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+				nil,
 			)
 			if err != nil {
 				t.Fatalf("could not create provisioner: %s", err)
 			}
 
 			prov.status.ID = nodeUUID
+			prov.retry.jitter = func() time.Duration { return 0 }
+			if tc.softPowerOffStarted != 0 {
+				prov.status.SoftPowerOffStarted = time.Now().Add(-tc.softPowerOffStarted)
+			}
 			result, err := prov.PowerOff()
 
 			assert.Equal(t, tc.expectedDirty, result.Dirty)
@@ -209,6 +403,141 @@ func TestPowerOff(t *testing.T) {
 			} else {
 				assert.Error(t, err)
 			}
+			if tc.expectSoftOffStartedReset {
+				assert.True(t, prov.status.SoftPowerOffStarted.IsZero())
+			}
 		})
 	}
 }
+
+// TestPowerOffEscalationDoesNotOscillate locks down the multi-call
+// behaviour after a soft power off escalates to a hard one: a later
+// reconcile must wait for the hard power off it already sent instead
+// of re-issuing a soft power off on top of it, which would clobber the
+// hard power off and restart the grace period forever.
+func TestPowerOffEscalationDoesNotOscillate(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+		PowerState:           powerOn,
+		TargetPowerState:     powerOn,
+		TargetProvisionState: "",
+		UUID:                 nodeUUID,
+	}).WithNodeStatesPowerForTarget(nodeUUID, powerOff, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	host.Spec.PowerOffMode = metal3v1alpha1.PowerOffModeSoft
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	prov.retry.jitter = func() time.Duration { return 0 }
+	prov.status.SoftPowerOffStarted = time.Now().Add(-(defaultSoftPowerOffTimeout + time.Minute))
+
+	// First call: the grace period elapsed, so this escalates to a
+	// hard power off. The mock only has a handler for the "power off"
+	// target, so a request for "soft power off" here would fail loudly.
+	result, err := prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.True(t, prov.status.HardPowerOffRequested)
+
+	// Second call: Ironic now reports the hard power off in flight. A
+	// buggy implementation would see SoftPowerOffStarted back at zero
+	// and re-issue a soft power off, which the mock has no handler for.
+	result, err = prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.True(t, prov.status.HardPowerOffRequested)
+
+	// Third call: Ironic reports the hard power off completed.
+	ironic.SetNodePowerState(nodeUUID, powerOff)
+	result, err = prov.PowerOff()
+	assert.NoError(t, err)
+	assert.False(t, result.Dirty)
+	assert.False(t, prov.status.HardPowerOffRequested)
+}
+
+// TestPowerOnClearsPendingHardPowerOff locks down that powering back on
+// abandons a pending hard power off escalation instead of leaving it to
+// haunt the next soft power off cycle: without the reset, a later
+// PowerOff() would see the stale flag and skip straight to a hard power
+// off, defeating PowerOffModeSoft for that cycle.
+func TestPowerOnClearsPendingHardPowerOff(t *testing.T) {
+	nodeUUID := "33ce8659-7400-4c68-9535-d10766f07a58"
+
+	ironic := testserver.NewIronic(t).Ready().WithNode(nodes.Node{
+		PowerState:           powerOn,
+		TargetPowerState:     powerOn,
+		TargetProvisionState: "",
+		UUID:                 nodeUUID,
+	}).WithNodeStatesPowerForTarget(nodeUUID, powerOff, http.StatusAccepted).
+		WithNodeStatesPowerForTarget(nodeUUID, powerOn, http.StatusAccepted).
+		WithNodeStatesPowerForTarget(nodeUUID, softPowerOff, http.StatusAccepted)
+	ironic.Start()
+	defer ironic.Stop()
+
+	inspector := testserver.NewInspector(t).Ready().WithIntrospection(nodeUUID, introspection.Introspection{
+		Finished: false,
+	})
+	inspector.Start()
+	defer inspector.Stop()
+
+	host := makeHost()
+	host.Spec.PowerOffMode = metal3v1alpha1.PowerOffModeSoft
+	publisher := func(reason, message string) {}
+	auth := clients.AuthConfig{Type: clients.NoAuth}
+	prov, err := newProvisionerWithSettings(host, bmc.Credentials{}, publisher,
+		ironic.Endpoint(), auth, inspector.Endpoint(), auth,
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("could not create provisioner: %s", err)
+	}
+
+	prov.status.ID = nodeUUID
+	prov.retry.jitter = func() time.Duration { return 0 }
+	prov.status.SoftPowerOffStarted = time.Now().Add(-(defaultSoftPowerOffTimeout + time.Minute))
+
+	// Escalate to a hard power off, same as above.
+	result, err := prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.True(t, prov.status.HardPowerOffRequested)
+
+	// The host is powered back on before the hard power off settles:
+	// the pending hard power off is abandoned.
+	result, err = prov.PowerOn()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.False(t, prov.status.HardPowerOffRequested)
+
+	// Ironic reports the node back on.
+	ironic.SetNodePowerState(nodeUUID, powerOn)
+
+	// A fresh PowerOff() must attempt a soft power off again rather
+	// than jumping straight to hard; the mock would reject a "power
+	// off" request here since it only expects "soft power off" with
+	// nothing in flight.
+	result, err = prov.PowerOff()
+	assert.NoError(t, err)
+	assert.True(t, result.Dirty)
+	assert.Equal(t, 10*time.Second, result.RequeueAfter)
+	assert.False(t, prov.status.SoftPowerOffStarted.IsZero())
+	assert.False(t, prov.status.HardPowerOffRequested)
+}
@@ -0,0 +1,203 @@
+// Package powerfsm models a node's power management lifecycle as an
+// explicit finite state machine, so the provisioner can reject illegal
+// transitions and centralize requeue timing in one table instead of
+// scattering ad-hoc (PowerState, TargetPowerState, TargetProvisionState)
+// checks through the code that drives Ironic.
+package powerfsm
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is one point in a node's power lifecycle.
+type State string
+
+const (
+	// Off means the node is powered off and nothing is pending.
+	Off State = "Off"
+	// TurningOn means a power-on request has been sent to Ironic and
+	// we are waiting for it to take effect.
+	TurningOn State = "TurningOn"
+	// On means the node is powered on and nothing is pending.
+	On State = "On"
+	// TurningOff means a power-off request has been sent to Ironic and
+	// we are waiting for it to take effect.
+	TurningOff State = "TurningOff"
+	// LockedBusy means Ironic rejected our last request because
+	// another caller holds the node's lock.
+	LockedBusy State = "LockedBusy"
+	// WaitingForProvisioning means a power request arrived while the
+	// node had a provisioning action in flight, and is queued until
+	// that action resolves.
+	WaitingForProvisioning State = "WaitingForProvisioning"
+)
+
+// Event is something that can happen to a node: a request from the
+// caller, or news from Ironic about the request already in flight.
+type Event string
+
+const (
+	// RequestOn asks the machine to move the node towards On.
+	RequestOn Event = "RequestOn"
+	// RequestOff asks the machine to move the node towards Off.
+	RequestOff Event = "RequestOff"
+	// IronicAck means Ironic accepted the in-flight request and the
+	// node reached the state it was moving towards.
+	IronicAck Event = "IronicAck"
+	// IronicConflict means Ironic rejected the in-flight request with
+	// HTTP 409 because another caller holds the node's lock.
+	IronicConflict Event = "IronicConflict"
+	// ProvisionStateCleared means the provisioning action that queued
+	// a request has finished.
+	ProvisionStateCleared Event = "ProvisionStateCleared"
+	// Timeout means the caller polled again before anything changed.
+	Timeout Event = "Timeout"
+)
+
+// pollRequeue is the default requeue interval for states that are
+// waiting on Ironic or on a queued request to become eligible.
+const pollRequeue = 10 * time.Second
+
+// Result is what firing an event tells the caller to do next.
+type Result struct {
+	State        State
+	RequeueAfter time.Duration
+}
+
+// IllegalTransitionError reports an event that the machine's current
+// state does not accept.
+type IllegalTransitionError struct {
+	State State
+	Event Event
+}
+
+func (e *IllegalTransitionError) Error() string {
+	return fmt.Sprintf("event %q is not valid in state %q", e.Event, e.State)
+}
+
+// Machine tracks a single node's power lifecycle.
+//
+// Driving Timeout, ProvisionStateCleared, and the LockedBusy/
+// WaitingForProvisioning resume they trigger requires keeping the same
+// Machine (and its pending field) alive across calls to Fire, which in
+// turn requires persisting it somewhere between reconciles. The ironic
+// package does not do that today -- its Machine is rebuilt from the
+// node's observed state on every call -- so those events are currently
+// only exercised by this package's own tests, not by a caller.
+// IronicConflict doesn't have that problem, since it fires within the
+// same call that created the Machine, and the ironic package does so.
+// IronicAck does have the problem in practice even though it could fire
+// within a single call in principle: the ironic package's event-driven
+// shortcut learns a node reached its target without fetching the node
+// or building a Machine at all, precisely to avoid the round trip doing
+// so would cost.
+type Machine struct {
+	state State
+
+	// pending remembers which direction (RequestOn or RequestOff) a
+	// LockedBusy or WaitingForProvisioning state is working towards,
+	// so a later Timeout or ProvisionStateCleared resumes the right
+	// transition.
+	pending Event
+}
+
+// New returns a Machine seeded in the given state, typically derived
+// from the power state most recently observed on the Ironic node.
+func New(initial State) *Machine {
+	return &Machine{state: initial}
+}
+
+// State returns the machine's current state.
+func (m *Machine) State() State {
+	return m.state
+}
+
+// Fire advances the machine on event, given whether the node
+// currently has a provisioning action in progress. It returns an
+// IllegalTransitionError, leaving the state unchanged, when event is
+// not valid from the current state.
+func (m *Machine) Fire(event Event, provisionInProgress bool) (Result, error) {
+	switch m.state {
+	case Off:
+		return m.fireFromSettled(event, RequestOff, RequestOn, TurningOn, provisionInProgress)
+	case On:
+		return m.fireFromSettled(event, RequestOn, RequestOff, TurningOff, provisionInProgress)
+
+	case TurningOn, TurningOff:
+		switch event {
+		case RequestOn, RequestOff:
+			// Already in flight: keep waiting for Ironic instead of
+			// issuing another request.
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		case IronicAck:
+			if m.state == TurningOn {
+				m.state = On
+			} else {
+				m.state = Off
+			}
+			m.pending = ""
+			return Result{State: m.state}, nil
+		case IronicConflict:
+			if m.state == TurningOn {
+				m.pending = RequestOn
+			} else {
+				m.pending = RequestOff
+			}
+			m.state = LockedBusy
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		case Timeout:
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		}
+
+	case LockedBusy:
+		switch event {
+		case Timeout:
+			m.state = m.resumePending()
+			return Result{State: m.state}, nil
+		case RequestOn, RequestOff:
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		}
+
+	case WaitingForProvisioning:
+		switch event {
+		case ProvisionStateCleared:
+			m.state = m.resumePending()
+			return Result{State: m.state}, nil
+		case RequestOn, RequestOff:
+			m.pending = event
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		}
+	}
+
+	return Result{State: m.state}, &IllegalTransitionError{State: m.state, Event: event}
+}
+
+// fireFromSettled implements the shared shape of the Off and On
+// states: the event matching the state we are already in is a no-op,
+// the opposite event either starts a transition or, if a provisioning
+// action is in progress, queues behind it.
+func (m *Machine) fireFromSettled(event, sameEvent, oppositeEvent Event, next State, provisionInProgress bool) (Result, error) {
+	switch event {
+	case sameEvent:
+		return Result{State: m.state}, nil
+	case oppositeEvent:
+		if provisionInProgress {
+			m.pending = oppositeEvent
+			m.state = WaitingForProvisioning
+			return Result{State: m.state, RequeueAfter: pollRequeue}, nil
+		}
+		m.state = next
+		return Result{State: m.state}, nil
+	}
+	return Result{State: m.state}, &IllegalTransitionError{State: m.state, Event: event}
+}
+
+func (m *Machine) resumePending() State {
+	pending := m.pending
+	m.pending = ""
+	if pending == RequestOff {
+		return TurningOff
+	}
+	return TurningOn
+}
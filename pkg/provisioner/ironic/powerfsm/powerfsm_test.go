@@ -0,0 +1,98 @@
+package powerfsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFireSequences(t *testing.T) {
+	cases := []struct {
+		name                string
+		initial             State
+		provisionInProgress bool
+		events              []Event
+		expectedState       State
+		expectedErrorOn     int // index into events that should fail, -1 for none
+	}{
+		{
+			name:            "power on from off",
+			initial:         Off,
+			events:          []Event{RequestOn, IronicAck},
+			expectedState:   On,
+			expectedErrorOn: -1,
+		},
+		{
+			name:            "power off from on",
+			initial:         On,
+			events:          []Event{RequestOff, IronicAck},
+			expectedState:   Off,
+			expectedErrorOn: -1,
+		},
+		{
+			name:            "conflict then resolves on timeout",
+			initial:         Off,
+			events:          []Event{RequestOn, IronicConflict, Timeout, IronicAck},
+			expectedState:   On,
+			expectedErrorOn: -1,
+		},
+		{
+			name:                "request off queues behind provisioning and clears",
+			initial:             On,
+			provisionInProgress: true,
+			events:              []Event{RequestOff, ProvisionStateCleared, IronicAck},
+			expectedState:       Off,
+			expectedErrorOn:     -1,
+		},
+		{
+			name:            "already on request on is a no-op",
+			initial:         On,
+			events:          []Event{RequestOn},
+			expectedState:   On,
+			expectedErrorOn: -1,
+		},
+		{
+			name:            "ack is illegal from a settled state",
+			initial:         On,
+			events:          []Event{IronicAck},
+			expectedState:   On,
+			expectedErrorOn: 0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New(tc.initial)
+			for i, event := range tc.events {
+				_, err := m.Fire(event, tc.provisionInProgress)
+				if tc.expectedErrorOn == i {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+			}
+			assert.Equal(t, tc.expectedState, m.State())
+		})
+	}
+}
+
+func TestDeletedProvisionStateQueuesRequestOff(t *testing.T) {
+	m := New(On)
+
+	result, err := m.Fire(RequestOff, true)
+	assert.NoError(t, err)
+	assert.Equal(t, WaitingForProvisioning, result.State)
+	assert.NotZero(t, result.RequeueAfter)
+
+	// Calling again while still in progress re-asserts the queued
+	// direction rather than firing.
+	result, err = m.Fire(RequestOff, true)
+	assert.NoError(t, err)
+	assert.Equal(t, WaitingForProvisioning, result.State)
+
+	// Once the provisioning action resolves, the queued power off
+	// actually fires.
+	result, err = m.Fire(ProvisionStateCleared, false)
+	assert.NoError(t, err)
+	assert.Equal(t, TurningOff, result.State)
+}
@@ -0,0 +1,55 @@
+package ironic
+
+import (
+	"math/rand"
+	"time"
+)
+
+// retryPolicy computes a bounded, jittered backoff for retrying a power
+// operation that Ironic rejected because another caller holds the
+// node's lock (HTTP 409), and caps how many times we will retry before
+// giving up on the node altogether.
+type retryPolicy struct {
+	base        time.Duration
+	cap         time.Duration
+	maxAttempts int
+
+	// jitter returns the random component added to the computed
+	// backoff. It is a field rather than a direct math/rand call so
+	// tests can stub it out for deterministic assertions.
+	jitter func() time.Duration
+}
+
+// lockedHostRetryPolicy is the default policy used for PowerOn,
+// PowerOff and ChangePower when Ironic reports the node is locked.
+var lockedHostRetryPolicy = retryPolicy{
+	base:        2 * time.Second,
+	cap:         5 * time.Minute,
+	maxAttempts: 5,
+	jitter: func() time.Duration {
+		return time.Duration(rand.Int63n(int64(time.Second)))
+	},
+}
+
+// requeueAfter returns how long to wait before retrying the given
+// attempt number (0-indexed), as min(cap, base*2^attempt) plus jitter.
+func (r retryPolicy) requeueAfter(attempt int) time.Duration {
+	backoff := r.cap
+	if shift := uint(attempt); shift < 32 {
+		if scaled := r.base * time.Duration(int64(1)<<shift); scaled > 0 && scaled < r.cap {
+			backoff = scaled
+		}
+	}
+
+	jitter := time.Duration(0)
+	if r.jitter != nil {
+		jitter = r.jitter()
+	}
+	return backoff + jitter
+}
+
+// exhausted reports whether attempt (0-indexed, the attempt about to be
+// made) is beyond the policy's retry budget.
+func (r retryPolicy) exhausted(attempt int) bool {
+	return attempt >= r.maxAttempts
+}
@@ -0,0 +1,33 @@
+package testserver
+
+import "github.com/metal3-io/baremetal-operator/pkg/provisioner/ironic/events"
+
+// FakeEventSource is a minimal stand-in for events.Source: it lets a
+// test push a synthetic NodeStateChanged straight onto the channel the
+// provisioner reads from, without standing up a real events.Dialer.
+type FakeEventSource struct {
+	ch chan events.NodeStateChanged
+}
+
+// NewFakeEventSource creates a FakeEventSource ready for use.
+func NewFakeEventSource() *FakeEventSource {
+	return &FakeEventSource{ch: make(chan events.NodeStateChanged, 1)}
+}
+
+// Events returns the channel the provisioner reads pushed state
+// transitions from.
+func (f *FakeEventSource) Events() <-chan events.NodeStateChanged {
+	return f.ch
+}
+
+// Emit pushes a synthetic state transition as if Ironic had observed
+// it.
+func (f *FakeEventSource) Emit(evt events.NodeStateChanged) {
+	f.ch <- evt
+}
+
+// Close simulates the event source giving up, letting tests exercise
+// the provisioner's fall back to polling.
+func (f *FakeEventSource) Close() {
+	close(f.ch)
+}
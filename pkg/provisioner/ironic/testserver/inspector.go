@@ -0,0 +1,38 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetalintrospection/v1/introspection"
+)
+
+// InspectorMock is a stand-in for the subset of the Ironic Inspector
+// API the provisioner talks to.
+type InspectorMock struct {
+	MockServer
+}
+
+// NewInspector creates a new InspectorMock. Start() must be called
+// before it can be used, typically after further configuring it With*.
+func NewInspector(t *testing.T) *InspectorMock {
+	return &InspectorMock{
+		MockServer: newMockServer(t),
+	}
+}
+
+// Ready registers the root handler used for client version negotiation.
+func (m *InspectorMock) Ready() *InspectorMock {
+	m.MockServer = m.MockServer.Ready()
+	return m
+}
+
+// WithIntrospection registers a canned introspection status response
+// for the given node UUID.
+func (m *InspectorMock) WithIntrospection(nodeUUID string, status introspection.Introspection) *InspectorMock {
+	m.mux.HandleFunc("/v1/introspection/"+nodeUUID, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(status) //nolint:errcheck
+	})
+	return m
+}
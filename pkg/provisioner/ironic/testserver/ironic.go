@@ -0,0 +1,126 @@
+package testserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/openstack/baremetal/v1/nodes"
+)
+
+// IronicMock is a stand-in for the subset of the Ironic API the
+// provisioner talks to.
+type IronicMock struct {
+	MockServer
+
+	nodes              map[string]*nodes.Node
+	powerResponses     map[string]map[string]int // nodeUUID -> target -> responseCode
+	defaultPowerResult map[string]int            // nodeUUID -> responseCode, used when target is not in powerResponses
+}
+
+// NewIronic creates a new IronicMock. Start() must be called before it
+// can be used, typically after further configuring it With*.
+func NewIronic(t *testing.T) *IronicMock {
+	return &IronicMock{
+		MockServer:         newMockServer(t),
+		nodes:              map[string]*nodes.Node{},
+		powerResponses:     map[string]map[string]int{},
+		defaultPowerResult: map[string]int{},
+	}
+}
+
+// Ready registers the root handler used for client version negotiation.
+func (m *IronicMock) Ready() *IronicMock {
+	m.MockServer = m.MockServer.Ready()
+	return m
+}
+
+// WithNode registers a node to be returned by GET /v1/nodes/<uuid>, and
+// updated in place as power state transitions happen via
+// WithNodeStatesPower.
+func (m *IronicMock) WithNode(node nodes.Node) *IronicMock {
+	n := node
+	m.nodes[n.UUID] = &n
+	m.mux.HandleFunc("/v1/nodes/"+n.UUID, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(m.nodes[n.UUID]) //nolint:errcheck
+	})
+	return m
+}
+
+// powerStateRequest mirrors the body Ironic expects on the
+// states/power endpoint.
+type powerStateRequest struct {
+	Target string `json:"target"`
+}
+
+// WithNodeStatesPower registers the given responseCode as the answer
+// to any PUT /v1/nodes/<uuid>/states/power request, regardless of the
+// requested target. It is kept for the existing hard power on/off
+// test cases.
+func (m *IronicMock) WithNodeStatesPower(nodeUUID string, responseCode int) *IronicMock {
+	m.ensurePowerHandler(nodeUUID)
+	m.defaultPowerResult[nodeUUID] = responseCode
+	return m
+}
+
+// WithNodeStatesPowerForTarget registers responseCode as the answer
+// only when the requested target matches, letting a single test
+// distinguish soft power off from the hard fallback.
+func (m *IronicMock) WithNodeStatesPowerForTarget(nodeUUID, target string, responseCode int) *IronicMock {
+	m.ensurePowerHandler(nodeUUID)
+	m.powerResponses[nodeUUID][target] = responseCode
+	return m
+}
+
+// ensurePowerHandler registers the states/power handler for nodeUUID
+// exactly once; repeated With* calls just add to the response tables
+// it consults.
+func (m *IronicMock) ensurePowerHandler(nodeUUID string) {
+	if _, ok := m.powerResponses[nodeUUID]; ok {
+		return
+	}
+	m.powerResponses[nodeUUID] = map[string]int{}
+
+	m.mux.HandleFunc("/v1/nodes/"+nodeUUID+"/states/power", func(w http.ResponseWriter, r *http.Request) {
+		var body powerStateRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		responseCode, ok := m.powerResponses[nodeUUID][body.Target]
+		if !ok {
+			responseCode, ok = m.defaultPowerResult[nodeUUID]
+		}
+		if !ok {
+			http.Error(w, "unexpected power target "+body.Target, http.StatusInternalServerError)
+			return
+		}
+
+		if responseCode == http.StatusAccepted {
+			if node, ok := m.nodes[nodeUUID]; ok {
+				node.TargetPowerState = body.Target
+			}
+		}
+		w.WriteHeader(responseCode)
+	})
+}
+
+// SetNodePowerState lets a test move a node straight to a power state,
+// simulating Ironic observing the out-of-band transition the soft or
+// hard power off request triggered.
+func (m *IronicMock) SetNodePowerState(nodeUUID, state string) {
+	if node, ok := m.nodes[nodeUUID]; ok {
+		node.PowerState = state
+		node.TargetPowerState = ""
+	}
+}
+
+// SetNodeTargetProvisionState lets a test simulate a provisioning
+// action in progress on a node finishing, without re-registering the
+// node's handler.
+func (m *IronicMock) SetNodeTargetProvisionState(nodeUUID, state string) {
+	if node, ok := m.nodes[nodeUUID]; ok {
+		node.TargetProvisionState = state
+	}
+}
@@ -0,0 +1,58 @@
+// Package testserver provides small httptest-backed stand-ins for the
+// Ironic and Ironic Inspector APIs, used by the provisioner's unit
+// tests.
+package testserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// MockServer is the common base for the Ironic and Inspector mocks. It
+// wires up an httptest.Server and lets callers register canned
+// responses for individual paths before starting it.
+type MockServer struct {
+	t        *testing.T
+	server   *httptest.Server
+	mux      *http.ServeMux
+	handlers []func(mux *http.ServeMux)
+}
+
+func newMockServer(t *testing.T) MockServer {
+	return MockServer{
+		t:   t,
+		mux: http.NewServeMux(),
+	}
+}
+
+// Ready registers the root handler as always returning a 200, which is
+// enough for gophercloud's client version negotiation.
+func (m MockServer) Ready() MockServer {
+	m.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	return m
+}
+
+// Start brings the underlying httptest.Server up. Callers must call
+// Stop when finished, typically via defer.
+func (m *MockServer) Start() {
+	m.server = httptest.NewServer(m.mux)
+}
+
+// Stop tears down the underlying httptest.Server.
+func (m *MockServer) Stop() {
+	if m.server != nil {
+		m.server.Close()
+	}
+}
+
+// Endpoint returns the base URL the mock is listening on.
+func (m *MockServer) Endpoint() string {
+	if m.server == nil {
+		m.t.Fatalf("testserver: Endpoint() called before Start()")
+	}
+	return fmt.Sprintf("%s/v1/", m.server.URL)
+}
@@ -0,0 +1,33 @@
+// Package provisioner defines the interface between the controller and
+// the backend that actually talks to a host's management controller.
+package provisioner
+
+import "time"
+
+// EventPublisher is a function provided by the caller used by the
+// provisioner to publish a Kubernetes event against the host it is
+// acting on.
+type EventPublisher func(reason, message string)
+
+// Result holds the response from a provisioner operation.
+type Result struct {
+	// Dirty indicates whether the host object needs to be saved.
+	Dirty bool
+	// RequeueAfter indicates how long to wait before checking the
+	// status again, when not zero.
+	RequeueAfter time.Duration
+	// ErrorMessage holds a message to be set on the host status when
+	// the operation could not be completed.
+	ErrorMessage string
+}
+
+// Provisioner holds the set of operations the controller needs to
+// provision a host, independent of the backend implementation.
+type Provisioner interface {
+	// PowerOn ensures the host is powered on.
+	PowerOn() (result Result, err error)
+	// PowerOff ensures the host is powered off.
+	PowerOff() (result Result, err error)
+	// ChangePower moves the host towards the given target power state.
+	ChangePower(target string) (result Result, err error)
+}